@@ -0,0 +1,227 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrThrottled is a sentinel error that callers of DoAdaptive may return
+// from f to indicate the backend rejected the call due to rate-limiting.
+var ErrThrottled = errors.New("throttle: backend throttled request")
+
+// ErrClientThrottled is returned by DoAdaptive when the client
+// pre-emptively rejected a call based on recent accept/throttle
+// statistics, without invoking f.
+var ErrClientThrottled = errors.New("throttle: client throttled request")
+
+// Outcome classifies the result of a single call for the purposes of
+// adaptive throttling.
+type Outcome int
+
+const (
+	// OutcomeAccept indicates the call succeeded.
+	OutcomeAccept Outcome = iota
+
+	// OutcomeThrottle indicates the call was rejected by the backend.
+	OutcomeThrottle
+)
+
+// AdaptiveRunner holds the methods of the interface.
+//
+// It throttles calls client-side based on recent accept/throttle
+// statistics, in the style of gRPC's client-side adaptive throttling
+// (RLS). Once a backend starts reporting throttles, AdaptiveRunner
+// pre-emptively rejects a proportion of calls itself, so a caller backs
+// off gradually instead of bursting the whole total at the configured
+// rate.
+type AdaptiveRunner struct {
+	rate int64
+	res  time.Duration
+	c    <-chan time.Time
+	k    float64
+	w    *window
+}
+
+// NewAdaptive returns a pointer to an instance of AdaptiveRunner, which
+// performs all operations at the given rate in requests/s, while also
+// self-throttling based on the ratio of accepts to throttles observed
+// over the last window duration, split into bins bins. k is the target
+// accept ratio used in the self-throttle probability calculation; gRPC's
+// RLS uses a default of 2.0.
+func NewAdaptive(rate int64, res, window time.Duration, bins int, k float64) *AdaptiveRunner {
+	r := AdaptiveRunner{
+		rate: rate,
+		res:  res,
+		k:    k,
+		w:    newWindow(window, bins),
+	}
+
+	if rate > 0 {
+		r.c = time.NewTicker(qos(rate, res)).C
+	}
+
+	return &r
+}
+
+// DoAdaptive executes f a given number of times, honoring the
+// configured rate and self-throttling based on recent accept/throttle
+// statistics. classify is used to turn the error returned by f into an
+// Outcome for the purposes of that statistic; a nil classify treats any
+// non-nil error as a throttle.
+//
+// Unlike Do/DoFor, DoAdaptive always runs every call rather than
+// stopping on the first error: the whole point is to let the
+// accept/throttle window and self-rejection graduate the caller's
+// effective rate down over the full total instead of bursting it, so
+// stopping early would defeat that. Every error, including
+// ErrClientThrottled from self-rejected calls, is collected and
+// returned joined together with errors.Join.
+func (r *AdaptiveRunner) DoAdaptive(ctx context.Context, total int, f func() error, classify func(error) Outcome) error {
+	if classify == nil {
+		classify = defaultClassify
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(total)
+
+	collector := newErrorCollector(ContinueOnError)
+	for i := 0; i < total; i++ {
+		if r.rate > 0 {
+			<-r.c
+		}
+
+		go func() {
+			defer wg.Done()
+
+			if r.reject() {
+				collector.submit(ErrClientThrottled)
+				return
+			}
+
+			err := f()
+			r.w.record(time.Now(), classify(err))
+			collector.submit(err)
+		}()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return collector.result()
+	case <-ctx.Done():
+		return nil
+	case <-collector.done:
+		return collector.result()
+	}
+}
+
+// reject reports whether the next call should be self-throttled,
+// based on p = max(0, (requests - k*accepts) / (requests + 1)).
+func (r *AdaptiveRunner) reject() bool {
+	accepts, throttles := r.w.totals(time.Now())
+	requests := accepts + throttles
+
+	p := (float64(requests) - r.k*float64(accepts)) / (float64(requests) + 1)
+	if p < 0 {
+		p = 0
+	}
+
+	return rand.Float64() < p
+}
+
+func defaultClassify(err error) Outcome {
+	if err == nil {
+		return OutcomeAccept
+	}
+	return OutcomeThrottle
+}
+
+// window is a ring buffer of bins counting accepts and throttles over
+// the last D duration, advanced by wall-clock time.
+type window struct {
+	mu   sync.Mutex
+	bins []windowBin
+	res  time.Duration
+	idx  int
+	last time.Time
+}
+
+type windowBin struct {
+	accepts   int64
+	throttles int64
+}
+
+// newWindow returns a window covering the last d duration, split into
+// bins equally sized bins.
+func newWindow(d time.Duration, bins int) *window {
+	return &window{
+		bins: make([]windowBin, bins),
+		res:  d / time.Duration(bins),
+	}
+}
+
+// advance moves the ring buffer forward to now, zeroing any bins that
+// have aged out of the window. Light time-travel (now close to last)
+// simply writes into the current bin; heavy time-travel (now more than
+// a full window before or after last) clears the buffer entirely.
+func (w *window) advance(now time.Time) {
+	if w.last.IsZero() {
+		w.last = now
+		return
+	}
+
+	elapsed := now.Sub(w.last)
+	n := int(elapsed / w.res)
+	if n >= len(w.bins) || n <= -len(w.bins) {
+		for i := range w.bins {
+			w.bins[i] = windowBin{}
+		}
+		w.idx = 0
+		w.last = now
+		return
+	}
+	if n <= 0 {
+		return
+	}
+
+	for i := 0; i < n; i++ {
+		w.idx = (w.idx + 1) % len(w.bins)
+		w.bins[w.idx] = windowBin{}
+	}
+	w.last = now
+}
+
+func (w *window) record(now time.Time, o Outcome) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.advance(now)
+
+	switch o {
+	case OutcomeAccept:
+		w.bins[w.idx].accepts++
+	case OutcomeThrottle:
+		w.bins[w.idx].throttles++
+	}
+}
+
+func (w *window) totals(now time.Time) (accepts, throttles int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.advance(now)
+
+	for _, b := range w.bins {
+		accepts += b.accepts
+		throttles += b.throttles
+	}
+	return accepts, throttles
+}
@@ -0,0 +1,101 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoAdaptive(t *testing.T) {
+	cases := []struct {
+		name  string
+		rps   int64
+		res   time.Duration
+		total int
+		exp   int64
+	}{
+		{name: "no throttle without requests", rps: 0, res: time.Millisecond, total: 0, exp: 0},
+		{name: "no throttle with 1 request", rps: 0, res: time.Millisecond, total: 1, exp: 1},
+		{name: "10/ms throttle with 10 requests", rps: 10, res: time.Millisecond, total: 10, exp: 10},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := NewAdaptive(c.rps, c.res, time.Second, 10, 2.0)
+
+			var sum int64
+			actErr := r.DoAdaptive(context.Background(), c.total, func() error {
+				atomic.AddInt64(&sum, 1)
+				return nil
+			}, nil)
+
+			equals(t, nil, actErr)
+			equals(t, c.exp, sum)
+		})
+	}
+}
+
+func TestDoAdaptiveRunsFullTotalOnError(t *testing.T) {
+	r := NewAdaptive(0, time.Millisecond, time.Second, 10, 2.0)
+
+	var sum int64
+	actErr := r.DoAdaptive(context.Background(), 5, func() error {
+		atomic.AddInt64(&sum, 1)
+		return ErrThrottled
+	}, nil)
+
+	// Once throttles are recorded, some calls may be self-rejected with
+	// ErrClientThrottled instead of reaching f; they still count towards
+	// the total.
+	var rejected int64
+	if joined, ok := actErr.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			if errors.Is(err, ErrClientThrottled) {
+				rejected++
+			}
+		}
+	}
+
+	equals(t, int64(5), sum+rejected)
+	if !errors.Is(actErr, ErrThrottled) {
+		t.Fatalf("expected the joined error to wrap ErrThrottled, got %v", actErr)
+	}
+}
+
+func TestWindowTotals(t *testing.T) {
+	w := newWindow(time.Second, 10)
+
+	now := time.Now()
+	w.record(now, OutcomeAccept)
+	w.record(now, OutcomeAccept)
+	w.record(now, OutcomeThrottle)
+
+	accepts, throttles := w.totals(now)
+	equals(t, int64(2), accepts)
+	equals(t, int64(1), throttles)
+}
+
+func TestWindowAdvanceExpiresOldBins(t *testing.T) {
+	w := newWindow(time.Second, 10)
+
+	now := time.Now()
+	w.record(now, OutcomeThrottle)
+
+	accepts, throttles := w.totals(now.Add(time.Second * 2))
+	equals(t, int64(0), accepts)
+	equals(t, int64(0), throttles)
+}
+
+func TestRejectNeverNegative(t *testing.T) {
+	r := NewAdaptive(0, time.Millisecond, time.Second, 10, 2.0)
+
+	now := time.Now()
+	r.w.record(now, OutcomeAccept)
+	r.w.record(now, OutcomeAccept)
+
+	if r.reject() {
+		t.Fatal("expected an all-accept window to never self-throttle")
+	}
+}
@@ -0,0 +1,117 @@
+package throttle
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by Do/DoFor when a call is short-circuited
+// because the attached CircuitBreaker is open, instead of invoking f.
+var ErrCircuitOpen = errors.New("throttle: circuit breaker open")
+
+// ErrDoomed is returned by Do/DoFor when the attached CircuitBreaker has
+// been open for longer than its doom duration, rather than continuing
+// to burn the remaining total or duration against a backend that shows
+// no sign of recovering.
+var ErrDoomed = errors.New("throttle: circuit breaker doomed")
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// CircuitBreaker tracks consecutive failures from f and trips open once
+// failureThreshold is reached, short-circuiting further calls for
+// cooldown before letting a single probe through (half-open). If it
+// remains open for longer than doom, callers should give up entirely
+// rather than keep retrying a backend that isn't recovering.
+type CircuitBreaker struct {
+	failureThreshold int
+	cooldown         time.Duration
+	doom             time.Duration
+
+	mu       sync.Mutex
+	state    circuitState
+	fails    int
+	openedAt time.Time
+
+	// trippedAt is when the breaker last went Open, either from Closed
+	// or after a failed probe; cooldown is measured from here.
+	trippedAt time.Time
+}
+
+// NewCircuitBreaker returns a pointer to an instance of CircuitBreaker
+// that trips open after failureThreshold consecutive failures, stays
+// open for cooldown before probing again, and is considered doomed once
+// it has been open for longer than doom.
+func NewCircuitBreaker(failureThreshold int, cooldown, doom time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		doom:             doom,
+	}
+}
+
+// allow reports whether a call should be permitted through the
+// breaker, transitioning it from Open to HalfOpen once cooldown has
+// elapsed.
+func (cb *CircuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case circuitOpen:
+		if time.Since(cb.trippedAt) < cb.cooldown {
+			return false
+		}
+		cb.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+// doomed reports whether the breaker has been open for longer than
+// doom.
+func (cb *CircuitBreaker) doomed() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return cb.state == circuitOpen && cb.doom > 0 && time.Since(cb.openedAt) > cb.doom
+}
+
+func (cb *CircuitBreaker) success() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.fails = 0
+	cb.state = circuitClosed
+}
+
+func (cb *CircuitBreaker) failure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == circuitHalfOpen {
+		// Back to Open for another cooldown, but openedAt is left
+		// alone: the breaker has been open continuously since the
+		// original trip, and doom must be measured from there, not
+		// reset on every failed probe.
+		cb.state = circuitOpen
+		cb.trippedAt = time.Now()
+		return
+	}
+
+	cb.fails++
+	if cb.fails >= cb.failureThreshold {
+		cb.state = circuitOpen
+		cb.openedAt = time.Now()
+		cb.trippedAt = cb.openedAt
+	}
+}
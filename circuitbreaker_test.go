@@ -0,0 +1,96 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTripsAndRecovers(t *testing.T) {
+	cb := NewCircuitBreaker(2, time.Millisecond*10, time.Second)
+
+	if !cb.allow() {
+		t.Fatal("expected a fresh breaker to allow calls")
+	}
+
+	cb.failure()
+	cb.failure()
+	if cb.allow() {
+		t.Fatal("expected breaker to be open after reaching the failure threshold")
+	}
+
+	time.Sleep(time.Millisecond * 20)
+	if !cb.allow() {
+		t.Fatal("expected breaker to allow a probe after cooldown")
+	}
+
+	cb.success()
+	if !cb.allow() {
+		t.Fatal("expected breaker to be closed after a successful probe")
+	}
+}
+
+func TestCircuitBreakerDoomed(t *testing.T) {
+	cb := NewCircuitBreaker(1, time.Millisecond, time.Millisecond*10)
+
+	cb.failure()
+	if cb.doomed() {
+		t.Fatal("expected a just-opened breaker not to be doomed yet")
+	}
+
+	time.Sleep(time.Millisecond * 20)
+	if !cb.doomed() {
+		t.Fatal("expected breaker open for longer than doom to be doomed")
+	}
+}
+
+func TestCircuitBreakerDoomedAfterRepeatedProbeFailures(t *testing.T) {
+	cb := NewCircuitBreaker(1, time.Millisecond*10, time.Millisecond*50)
+
+	cb.failure()
+
+	deadline := time.Now().Add(time.Millisecond * 300)
+	for time.Now().Before(deadline) {
+		if cb.doomed() {
+			return
+		}
+		if cb.allow() {
+			cb.failure()
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatal("expected breaker to be doomed once open for longer than doom, even with repeated probe failures resetting cooldown")
+}
+
+func TestDoWithCircuitBreaker(t *testing.T) {
+	cb := NewCircuitBreaker(1, time.Hour, time.Hour)
+	r := New(0, time.Millisecond, WithCircuitBreaker(cb))
+
+	err := r.Do(context.Background(), 1, func() error {
+		return fmt.Errorf("oh no!")
+	})
+	if err == nil {
+		t.Fatal("expected the first failing call to return its own error")
+	}
+
+	err = r.Do(context.Background(), 1, func() error {
+		t.Fatal("f should not be invoked while the breaker is open")
+		return nil
+	})
+	equals(t, ErrCircuitOpen, err)
+}
+
+func TestDoAbortsWhenDoomed(t *testing.T) {
+	cb := NewCircuitBreaker(1, time.Hour, time.Millisecond)
+	cb.failure()
+	time.Sleep(time.Millisecond * 10)
+
+	r := New(0, time.Millisecond, WithCircuitBreaker(cb))
+	err := r.Do(context.Background(), 5, func() error {
+		t.Fatal("f should not be invoked once the breaker is doomed")
+		return nil
+	})
+	equals(t, ErrDoomed, err)
+}
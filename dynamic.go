@@ -0,0 +1,219 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DynamicRunner holds the methods of the interface.
+//
+// Unlike Runner, which only limits the rate of calls, DynamicRunner
+// also limits the number of calls in flight, adjusting that limit up
+// and down based on success/failure feedback from f, in the style of
+// Vespa's feed client throttler. On success the target concurrency
+// grows additively; on failure or ErrThrottled it is halved, so a
+// slow or struggling downstream naturally caps the caller's
+// parallelism instead of being hit with an unbounded number of
+// goroutines.
+type DynamicRunner struct {
+	rate int64
+	res  time.Duration
+	c    <-chan time.Time
+
+	minInflight int64
+	maxInflight int64
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	target   int64
+	inFlight int64
+
+	successes int64
+	throttles int64
+}
+
+// NewDynamic returns a pointer to an instance of DynamicRunner, which
+// performs all operations at the given rate in requests/s, while
+// additionally bounding the number of concurrent calls to f between
+// minInflight and maxInflight, adjusting the bound with an AIMD
+// (additive-increase, multiplicative-decrease) policy.
+func NewDynamic(rate int64, res time.Duration, minInflight, maxInflight int64) *DynamicRunner {
+	r := DynamicRunner{
+		rate:        rate,
+		res:         res,
+		minInflight: minInflight,
+		maxInflight: maxInflight,
+		target:      minInflight,
+	}
+	r.cond = sync.NewCond(&r.mu)
+
+	if rate > 0 {
+		r.c = time.NewTicker(qos(rate, res)).C
+	}
+
+	return &r
+}
+
+// Do executes a function a given number of times, honoring both the
+// configured rate and the current target concurrency.
+func (r *DynamicRunner) Do(ctx context.Context, total int, f func() error) error {
+	var wg sync.WaitGroup
+	wg.Add(total)
+
+	collector := newErrorCollector(ErrorPolicy{})
+	for i := 0; i < total; i++ {
+		if r.rate > 0 {
+			<-r.c
+		}
+
+		if err := r.acquire(ctx); err != nil {
+			for ; i < total; i++ {
+				wg.Done()
+			}
+			wg.Wait()
+			return nil
+		}
+		go func() {
+			defer wg.Done()
+			defer r.release()
+
+			err := f()
+			r.feedback(err)
+			collector.submit(err)
+		}()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return collector.result()
+	case <-ctx.Done():
+		return nil
+	case <-collector.done:
+		return collector.result()
+	}
+}
+
+// DoFor executes a function for a given amount of time, honoring both
+// the configured rate and the current target concurrency.
+func (r *DynamicRunner) DoFor(ctx context.Context, d time.Duration, f func() error) error {
+	if d == 0 {
+		return nil
+	}
+
+	end := time.After(d)
+	collector := newErrorCollector(ErrorPolicy{})
+	var wg sync.WaitGroup
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return nil
+		case <-end:
+			wg.Wait()
+			return collector.result()
+		case <-collector.done:
+			wg.Wait()
+			return collector.result()
+		default:
+			if r.rate > 0 {
+				<-r.c
+			}
+
+			if err := r.acquire(ctx); err != nil {
+				wg.Wait()
+				return nil
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer r.release()
+
+				err := f()
+				r.feedback(err)
+				collector.submit(err)
+			}()
+		}
+	}
+}
+
+// Stats returns the current target concurrency and the number of
+// successes and throttles observed so far.
+func (r *DynamicRunner) Stats() (target, successes, throttles int64) {
+	r.mu.Lock()
+	target = r.target
+	r.mu.Unlock()
+
+	return target, atomic.LoadInt64(&r.successes), atomic.LoadInt64(&r.throttles)
+}
+
+// acquire blocks until a slot within the current target concurrency is
+// available, or ctx is done. cond.Wait has no notion of ctx, so a
+// helper goroutine broadcasts on it when ctx is done, waking every
+// waiter up to recheck ctx.Err.
+func (r *DynamicRunner) acquire(ctx context.Context) error {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			r.mu.Lock()
+			r.cond.Broadcast()
+			r.mu.Unlock()
+		case <-stop:
+		}
+	}()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for r.inFlight >= r.target {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		r.cond.Wait()
+	}
+	r.inFlight++
+	return nil
+}
+
+// release frees a slot acquired by acquire and wakes any waiters, since
+// feedback may have changed the target in the meantime.
+func (r *DynamicRunner) release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.inFlight--
+	r.cond.Signal()
+}
+
+// feedback applies the AIMD policy: grow the target additively on
+// success, halve it (bounded by minInflight) on failure or
+// ErrThrottled.
+func (r *DynamicRunner) feedback(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err == nil {
+		atomic.AddInt64(&r.successes, 1)
+		if r.target < r.maxInflight {
+			r.target++
+		}
+	} else {
+		atomic.AddInt64(&r.throttles, 1)
+		r.target /= 2
+		if r.target < r.minInflight {
+			r.target = r.minInflight
+		}
+	}
+
+	r.cond.Broadcast()
+}
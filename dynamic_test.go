@@ -0,0 +1,88 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDynamicDo(t *testing.T) {
+	cases := []struct {
+		name  string
+		rps   int64
+		res   time.Duration
+		total int
+		exp   int64
+		err   error
+	}{
+		{name: "no throttle without requests", rps: 0, res: time.Millisecond, total: 0, exp: 0},
+		{name: "no throttle with requests", rps: 0, res: time.Millisecond, total: 5, exp: 5},
+		{name: "10/ms throttle with 10 requests", rps: 10, res: time.Millisecond, total: 10, exp: 10},
+		{name: "10/ms throttle with 10 requests with error", rps: 10, res: time.Millisecond, total: 10, err: fmt.Errorf("oh no!")},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := NewDynamic(c.rps, c.res, 1, 4)
+
+			var sum int64
+			actErr := r.Do(context.Background(), c.total, func() error {
+				atomic.AddInt64(&sum, 1)
+				return c.err
+			})
+
+			equals(t, c.err, actErr)
+			if c.err != nil {
+				return
+			}
+			equals(t, c.exp, sum)
+		})
+	}
+}
+
+func TestDynamicCancelDoReturnsPromptly(t *testing.T) {
+	r := NewDynamic(0, time.Millisecond, 1, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		r.Do(ctx, 5, func() error {
+			time.Sleep(time.Millisecond * 500)
+			return nil
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 2):
+		t.Fatal("Do did not return within 2s of a pre-cancelled ctx; acquire is likely ignoring cancellation")
+	}
+}
+
+func TestDynamicFeedbackGrowsAndShrinksTarget(t *testing.T) {
+	r := NewDynamic(0, time.Millisecond, 1, 4)
+
+	r.feedback(nil)
+	target, successes, throttles := r.Stats()
+	equals(t, int64(2), target)
+	equals(t, int64(1), successes)
+	equals(t, int64(0), throttles)
+
+	r.feedback(fmt.Errorf("oh no!"))
+	target, successes, throttles = r.Stats()
+	equals(t, int64(1), target)
+	equals(t, int64(1), successes)
+	equals(t, int64(1), throttles)
+}
+
+func TestDynamicFeedbackNeverBelowMin(t *testing.T) {
+	r := NewDynamic(0, time.Millisecond, 2, 4)
+
+	r.feedback(fmt.Errorf("oh no!"))
+	target, _, _ := r.Stats()
+	equals(t, int64(2), target)
+}
@@ -0,0 +1,106 @@
+package throttle
+
+import (
+	"errors"
+	"sync"
+)
+
+type errorPolicyMode int
+
+const (
+	policyStopOnFirst errorPolicyMode = iota
+	policyContinueOnError
+	policyMaxErrors
+)
+
+// ErrorPolicy controls how Do/DoFor react to errors returned by f.
+type ErrorPolicy struct {
+	mode    errorPolicyMode
+	maxErrs int
+}
+
+// StopOnFirst returns as soon as the first error is seen, which is the
+// default if no ErrorPolicy is configured. In-flight calls to f are
+// still allowed to finish in the background rather than being abandoned
+// mid-flight.
+var StopOnFirst = ErrorPolicy{mode: policyStopOnFirst}
+
+// ContinueOnError lets every call to f run to completion, then returns
+// all the errors seen, joined together with errors.Join.
+var ContinueOnError = ErrorPolicy{mode: policyContinueOnError}
+
+// MaxErrors returns an ErrorPolicy that lets calls to f continue until
+// n errors have accumulated, then returns them joined together with
+// errors.Join.
+func MaxErrors(n int) ErrorPolicy {
+	return ErrorPolicy{mode: policyMaxErrors, maxErrs: n}
+}
+
+// WithErrorPolicy sets how Do/DoFor should react to errors returned by
+// f. Without this option, a Runner behaves as if StopOnFirst were set.
+func WithErrorPolicy(policy ErrorPolicy) Option {
+	return func(r *Runner) {
+		r.errPolicy = policy
+	}
+}
+
+// errorCollector gathers the errors returned by concurrent calls to f
+// according to an ErrorPolicy. submit never blocks, so a call to f can
+// always hand its error off and return, even after Do/DoFor has itself
+// already returned - this is what stops goroutines leaking on a channel
+// nobody is reading any more.
+type errorCollector struct {
+	policy ErrorPolicy
+
+	mu   sync.Mutex
+	errs []error
+
+	done chan struct{}
+	once sync.Once
+}
+
+func newErrorCollector(policy ErrorPolicy) *errorCollector {
+	return &errorCollector{
+		policy: policy,
+		done:   make(chan struct{}),
+	}
+}
+
+// submit records a non-nil err. Once the policy is satisfied (the
+// first error under StopOnFirst, or the nth under MaxErrors), done is
+// closed so a waiting Do/DoFor can stop early.
+func (c *errorCollector) submit(err error) {
+	if err == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.errs = append(c.errs, err)
+	n := len(c.errs)
+	c.mu.Unlock()
+
+	switch c.policy.mode {
+	case policyStopOnFirst:
+		c.once.Do(func() { close(c.done) })
+	case policyMaxErrors:
+		if n >= c.policy.maxErrs {
+			c.once.Do(func() { close(c.done) })
+		}
+	}
+}
+
+// result reports the error Do/DoFor should return: the first error
+// under StopOnFirst, or every error joined together otherwise. It is
+// safe to call before all calls to f have finished.
+func (c *errorCollector) result() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.errs) == 0 {
+		return nil
+	}
+	if c.policy.mode == policyStopOnFirst {
+		return c.errs[0]
+	}
+	return errors.Join(c.errs...)
+}
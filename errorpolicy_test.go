@@ -0,0 +1,101 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStopOnFirstDoesNotLeakGoroutines(t *testing.T) {
+	r := New(0, time.Millisecond)
+	before := runtime.NumGoroutine()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Do(context.Background(), 20, func() error {
+			return fmt.Errorf("oh no!")
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Do did not return within a second; a goroutine is likely blocked sending its error")
+	}
+
+	waitForGoroutines(t, before)
+}
+
+func TestContinueOnErrorJoinsAllErrors(t *testing.T) {
+	errA := fmt.Errorf("error a")
+	errB := fmt.Errorf("error b")
+
+	r := New(0, time.Millisecond, WithErrorPolicy(ContinueOnError))
+
+	var i int64
+	actErr := r.Do(context.Background(), 3, func() error {
+		switch atomic.AddInt64(&i, 1) {
+		case 1:
+			return errA
+		case 2:
+			return errB
+		default:
+			return nil
+		}
+	})
+
+	if !errors.Is(actErr, errA) || !errors.Is(actErr, errB) {
+		t.Fatalf("expected joined error to wrap both errA and errB, got %v", actErr)
+	}
+}
+
+func TestMaxErrorsReturnsJoinedError(t *testing.T) {
+	r := New(0, time.Millisecond, WithErrorPolicy(MaxErrors(2)))
+
+	actErr := r.Do(context.Background(), 10, func() error {
+		return fmt.Errorf("oh no!")
+	})
+
+	if actErr == nil {
+		t.Fatal("expected a non-nil joined error once MaxErrors was reached")
+	}
+}
+
+func TestDoForStopOnFirstDoesNotLeakGoroutines(t *testing.T) {
+	r := New(1000, time.Second)
+	before := runtime.NumGoroutine()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- r.DoFor(context.Background(), time.Millisecond*50, func() error {
+			return fmt.Errorf("oh no!")
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("DoFor did not return within a second; a goroutine is likely blocked sending its error")
+	}
+
+	waitForGoroutines(t, before)
+}
+
+// waitForGoroutines fails the test unless the number of goroutines drops
+// back to at most before within a second, i.e. every call to f has
+// handed off its error and exited instead of staying blocked.
+func waitForGoroutines(t *testing.T, before int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines leaked: %d before, %d after", before, runtime.NumGoroutine())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,226 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats summarises the calls made by a Runner created with WithMetrics,
+// covering both latency and outcome.
+type Stats struct {
+	Total     int64
+	Success   int64
+	Errors    int64
+	Throttled int64
+	Cancelled int64
+
+	Fastest time.Duration
+	Slowest time.Duration
+	Mean    time.Duration
+	P50     time.Duration
+	P95     time.Duration
+	P99     time.Duration
+
+	// RPS is the rate actually achieved, as opposed to the rate the
+	// Runner was configured with.
+	RPS float64
+}
+
+// WithMetrics enables per-call latency and outcome tracking on a
+// Runner, making Stats and Reset meaningful. It is off by default, so
+// that Do/DoFor don't pay for timing calls nobody reads.
+func WithMetrics() Option {
+	return func(r *Runner) {
+		r.metrics = newMetrics()
+	}
+}
+
+// Stats returns the latency and outcome statistics collected so far. It
+// returns a zero Stats if the Runner wasn't created with WithMetrics.
+func (r *Runner) Stats() Stats {
+	if r.metrics == nil {
+		return Stats{}
+	}
+	return r.metrics.stats()
+}
+
+// Reset zeroes the statistics collected so far. It is a no-op if the
+// Runner wasn't created with WithMetrics.
+func (r *Runner) Reset() {
+	if r.metrics != nil {
+		r.metrics.reset()
+	}
+}
+
+// call invokes f, recording its latency and outcome if metrics are
+// enabled.
+func (r *Runner) call(f func() error) error {
+	if r.metrics == nil {
+		return f()
+	}
+
+	start := time.Now()
+	err := f()
+	r.metrics.record(time.Since(start), err)
+	return err
+}
+
+// metrics is the optional per-call timing and outcome tracker attached
+// to a Runner by WithMetrics.
+type metrics struct {
+	hist histogram
+
+	success   int64
+	errors    int64
+	throttled int64
+	cancelled int64
+
+	mu    sync.Mutex
+	start time.Time
+}
+
+func newMetrics() *metrics {
+	return &metrics{start: time.Now()}
+}
+
+func (m *metrics) record(d time.Duration, err error) {
+	m.hist.record(d)
+
+	switch {
+	case err == nil:
+		atomic.AddInt64(&m.success, 1)
+	case errors.Is(err, ErrThrottled):
+		atomic.AddInt64(&m.throttled, 1)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		atomic.AddInt64(&m.cancelled, 1)
+	default:
+		atomic.AddInt64(&m.errors, 1)
+	}
+}
+
+func (m *metrics) reset() {
+	m.hist.reset()
+	atomic.StoreInt64(&m.success, 0)
+	atomic.StoreInt64(&m.errors, 0)
+	atomic.StoreInt64(&m.throttled, 0)
+	atomic.StoreInt64(&m.cancelled, 0)
+
+	m.mu.Lock()
+	m.start = time.Now()
+	m.mu.Unlock()
+}
+
+func (m *metrics) stats() Stats {
+	m.mu.Lock()
+	elapsed := time.Since(m.start)
+	m.mu.Unlock()
+
+	count, min, max, mean := m.hist.summary()
+
+	var rps float64
+	if elapsed > 0 {
+		rps = float64(count) / elapsed.Seconds()
+	}
+
+	return Stats{
+		Total:     count,
+		Success:   atomic.LoadInt64(&m.success),
+		Errors:    atomic.LoadInt64(&m.errors),
+		Throttled: atomic.LoadInt64(&m.throttled),
+		Cancelled: atomic.LoadInt64(&m.cancelled),
+		Fastest:   min,
+		Slowest:   max,
+		Mean:      mean,
+		P50:       m.hist.percentile(0.50),
+		P95:       m.hist.percentile(0.95),
+		P99:       m.hist.percentile(0.99),
+		RPS:       rps,
+	}
+}
+
+// histogram is a bucketed, HDR-histogram-like structure for tracking
+// call latencies without storing every sample. Each bucket i holds the
+// count of durations whose bit-length is i, i.e. durations in
+// [2^(i-1), 2^i) nanoseconds, giving exact min/mean and approximate
+// percentiles at a fixed, small memory cost.
+type histogram struct {
+	mu      sync.Mutex
+	buckets [64]int64
+	count   int64
+	sum     int64
+	min     int64
+	max     int64
+}
+
+func (h *histogram) record(d time.Duration) {
+	n := int64(d)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.buckets[bits.Len64(uint64(n))]++
+	h.count++
+	h.sum += n
+
+	if h.count == 1 || n < h.min {
+		h.min = n
+	}
+	if n > h.max {
+		h.max = n
+	}
+}
+
+func (h *histogram) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.buckets = [64]int64{}
+	h.count = 0
+	h.sum = 0
+	h.min = 0
+	h.max = 0
+}
+
+func (h *histogram) summary() (count int64, min, max, mean time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.count == 0 {
+		return 0, 0, 0, 0
+	}
+
+	return h.count, time.Duration(h.min), time.Duration(h.max), time.Duration(h.sum / h.count)
+}
+
+// percentile returns the upper bound, in nanoseconds, of the bucket
+// containing the p-th percentile (0 < p <= 1) of recorded durations.
+func (h *histogram) percentile(p float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.count == 0 {
+		return 0
+	}
+
+	target := int64(p * float64(h.count))
+	if target < 1 {
+		target = 1
+	}
+
+	var cum int64
+	for idx, c := range h.buckets {
+		if c == 0 {
+			continue
+		}
+		cum += c
+		if cum >= target {
+			return time.Duration(int64(1)<<uint(idx) - 1)
+		}
+	}
+
+	return time.Duration(h.max)
+}
@@ -0,0 +1,75 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStatsWithoutMetricsIsZero(t *testing.T) {
+	r := New(0, time.Millisecond)
+	r.Do(context.Background(), 5, func() error { return nil })
+
+	equals(t, Stats{}, r.Stats())
+}
+
+func TestStatsCountsOutcomes(t *testing.T) {
+	r := New(0, time.Millisecond, WithMetrics())
+
+	// Do returns as soon as it sees the first error, so drive one call
+	// at a time to keep each outcome's recording deterministic.
+	outcomes := []error{nil, ErrThrottled, context.Canceled, fmt.Errorf("oh no!")}
+	for _, err := range outcomes {
+		r.Do(context.Background(), 1, func() error { return err })
+	}
+
+	s := r.Stats()
+	equals(t, int64(4), s.Total)
+	equals(t, int64(1), s.Success)
+	equals(t, int64(1), s.Throttled)
+	equals(t, int64(1), s.Cancelled)
+	equals(t, int64(1), s.Errors)
+}
+
+func TestStatsLatencyBounds(t *testing.T) {
+	r := New(0, time.Millisecond, WithMetrics())
+
+	r.Do(context.Background(), 3, func() error {
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+
+	s := r.Stats()
+	if s.Fastest <= 0 || s.Slowest < s.Fastest {
+		t.Fatalf("expected sane latency bounds, got fastest=%s slowest=%s", s.Fastest, s.Slowest)
+	}
+	if s.P50 <= 0 || s.P99 <= 0 {
+		t.Fatalf("expected non-zero percentiles, got p50=%s p99=%s", s.P50, s.P99)
+	}
+}
+
+func TestReset(t *testing.T) {
+	r := New(0, time.Millisecond, WithMetrics())
+
+	r.Do(context.Background(), 5, func() error { return nil })
+	if r.Stats().Total != 5 {
+		t.Fatal("expected 5 recorded calls before reset")
+	}
+
+	r.Reset()
+	equals(t, int64(0), r.Stats().Total)
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	h := histogram{}
+	for i := 1; i <= 100; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+
+	p50 := h.percentile(0.50)
+	p99 := h.percentile(0.99)
+	if p50 <= 0 || p99 < p50 {
+		t.Fatalf("expected p99 >= p50 > 0, got p50=%s p99=%s", p50, p99)
+	}
+}
@@ -3,6 +3,7 @@ package throttle
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -11,6 +12,31 @@ type Runner struct {
 	rate int64
 	res  time.Duration
 	c    <-chan time.Time
+
+	// burst, qos, tokens and lastRefill are only set when the Runner
+	// was created with NewBucket, in which case Do/DoFor schedule
+	// calls via acquire instead of the fixed-interval ticker above.
+	burst      int64
+	qos        time.Duration
+	tokens     int64
+	lastRefill int64 // unix nanoseconds, accessed atomically
+
+	cb        *CircuitBreaker
+	metrics   *metrics
+	errPolicy ErrorPolicy
+}
+
+// Option configures optional behaviour on a Runner created with New.
+type Option func(*Runner)
+
+// WithCircuitBreaker attaches a CircuitBreaker to a Runner. While the
+// breaker is open, Do/DoFor short-circuit calls with ErrCircuitOpen
+// instead of invoking f, and abort entirely with ErrDoomed if the
+// breaker has been open for longer than its doom duration.
+func WithCircuitBreaker(cb *CircuitBreaker) Option {
+	return func(r *Runner) {
+		r.cb = cb
+	}
 }
 
 // New returns a pointer to an instance of runner, which is used to
@@ -19,7 +45,7 @@ type Runner struct {
 // Rate and Res can be used in conjection to give you a run frequency.
 // For example rate = 10, res = time.Second will run something 10 times
 // every second.
-func New(rate int64, res time.Duration) *Runner {
+func New(rate int64, res time.Duration, opts ...Option) *Runner {
 	r := Runner{
 		rate: rate,
 		res:  res,
@@ -29,28 +55,89 @@ func New(rate int64, res time.Duration) *Runner {
 		r.c = time.NewTicker(qos(rate, res)).C
 	}
 
+	for _, opt := range opts {
+		opt(&r)
+	}
+
 	return &r
 }
 
+// NewBucket returns a pointer to an instance of Runner configured to
+// use token-bucket scheduling rather than a fixed-interval ticker. rate
+// and res set the steady-state refill rate, exactly as with New, and
+// burst is the number of tokens the bucket can accumulate while idle,
+// allowing that many calls through immediately before falling back to
+// the steady-state rate. burst must be at least 1; Do/DoFor select
+// their scheduling path on whether burst > 0, so a burst of 0 would
+// otherwise fall through to the ticker-based path below with no
+// ticker set up to read from.
+func NewBucket(rate int64, res time.Duration, burst int64) *Runner {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Runner{
+		rate:       rate,
+		res:        res,
+		burst:      burst,
+		qos:        qos(rate, res),
+		tokens:     burst,
+		lastRefill: time.Now().UnixNano(),
+	}
+}
+
 // Do executes a function a given number of times.  For example, if
 // your throttler is configured to run 10 operations per second and
 // you pass 50 for total, this will execute the function 50 times
 // and take 5 seconds.
+//
+// If ctx is cancelled, Do stops scheduling new calls and returns nil,
+// but still waits for calls to f already in flight to finish, rather
+// than abandoning their goroutines - callers whose f respects ctx
+// should return promptly from it on cancellation too, or Do's return
+// will be delayed by however long the slowest in-flight call takes.
 func (r *Runner) Do(ctx context.Context, total int, f func() error) error {
 	var wg sync.WaitGroup
 	wg.Add(total)
 
-	errors := make(chan error)
+	collector := newErrorCollector(r.errPolicy)
 	for i := 0; i < total; i++ {
-		if r.rate > 0 {
+		if r.burst > 0 {
+			if err := r.acquire(ctx); err != nil {
+				for ; i < total; i++ {
+					wg.Done()
+				}
+				wg.Wait()
+				return nil
+			}
+		} else if r.rate > 0 {
 			<-r.c
 		}
 
+		if r.cb != nil && r.cb.doomed() {
+			for ; i < total; i++ {
+				wg.Done()
+			}
+			return ErrDoomed
+		}
+
 		go func() {
 			defer wg.Done()
-			if err := f(); err != nil {
-				errors <- err
+
+			if r.cb != nil && !r.cb.allow() {
+				collector.submit(ErrCircuitOpen)
+				return
 			}
+
+			err := r.call(f)
+			if r.cb != nil {
+				if err != nil {
+					r.cb.failure()
+				} else {
+					r.cb.success()
+				}
+			}
+			collector.submit(err)
 		}()
 	}
 
@@ -58,18 +145,17 @@ func (r *Runner) Do(ctx context.Context, total int, f func() error) error {
 	finished := make(chan struct{})
 	go func() {
 		wg.Wait()
-		finished <- struct{}{}
+		close(finished)
 	}()
 
-	for {
-		select {
-		case <-finished:
-			return nil
-		case <-ctx.Done():
-			return nil
-		case err := <-errors:
-			return err
-		}
+	select {
+	case <-finished:
+		return collector.result()
+	case <-ctx.Done():
+		wg.Wait()
+		return nil
+	case <-collector.done:
+		return collector.result()
 	}
 }
 
@@ -82,7 +168,7 @@ func (r *Runner) DoFor(ctx context.Context, d time.Duration, f func() error) err
 	}
 
 	end := time.After(d)
-	errors := make(chan error)
+	collector := newErrorCollector(r.errPolicy)
 	var wg sync.WaitGroup
 	for {
 		select {
@@ -91,20 +177,54 @@ func (r *Runner) DoFor(ctx context.Context, d time.Duration, f func() error) err
 			return nil
 		case <-end:
 			wg.Wait()
-			return nil
-		case err := <-errors:
-			return err
+			return collector.result()
+		case <-collector.done:
+			wg.Wait()
+			return collector.result()
 		default:
-			if r.rate > 0 {
+			// A submit may have landed between this default branch
+			// being chosen and the done case above being checked, so
+			// re-check it here non-blockingly before scheduling
+			// another call - otherwise a satisfied StopOnFirst policy
+			// keeps letting extra calls through.
+			select {
+			case <-collector.done:
+				continue
+			default:
+			}
+
+			if r.burst > 0 {
+				if err := r.acquire(ctx); err != nil {
+					wg.Wait()
+					return nil
+				}
+			} else if r.rate > 0 {
 				<-r.c
 			}
 
+			if r.cb != nil && r.cb.doomed() {
+				wg.Wait()
+				return ErrDoomed
+			}
+
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				if err := f(); err != nil {
-					errors <- err
+
+				if r.cb != nil && !r.cb.allow() {
+					collector.submit(ErrCircuitOpen)
+					return
 				}
+
+				err := r.call(f)
+				if r.cb != nil {
+					if err != nil {
+						r.cb.failure()
+					} else {
+						r.cb.success()
+					}
+				}
+				collector.submit(err)
 			}()
 		}
 	}
@@ -114,3 +234,49 @@ func qos(rate int64, res time.Duration) time.Duration {
 	micros := res.Nanoseconds()
 	return time.Duration(micros/rate) * time.Nanosecond
 }
+
+// acquire decrements a token from the bucket, blocking until one is
+// available if the bucket is currently empty. It respects context
+// cancellation while waiting.
+func (r *Runner) acquire(ctx context.Context) error {
+	for {
+		r.refill()
+
+		if atomic.AddInt64(&r.tokens, -1) >= 0 {
+			return nil
+		}
+		atomic.AddInt64(&r.tokens, 1)
+
+		select {
+		case <-time.After(r.qos):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// refill lazily tops up the bucket based on elapsed wall-clock time
+// since the last refill, capped at burst.
+func (r *Runner) refill() {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&r.lastRefill)
+
+	added := time.Duration(now-last) / r.qos
+	if added <= 0 {
+		return
+	}
+	if !atomic.CompareAndSwapInt64(&r.lastRefill, last, last+int64(added)*int64(r.qos)) {
+		return
+	}
+
+	for {
+		cur := atomic.LoadInt64(&r.tokens)
+		next := cur + int64(added)
+		if next > r.burst {
+			next = r.burst
+		}
+		if atomic.CompareAndSwapInt64(&r.tokens, cur, next) {
+			return
+		}
+	}
+}
@@ -106,6 +106,37 @@ func TestQOS(t *testing.T) {
 	}
 }
 
+func TestBucketBurst(t *testing.T) {
+	r := NewBucket(1, time.Second, 5)
+
+	start := time.Now()
+
+	var sum int64
+	r.Do(context.Background(), 5, func() error {
+		atomic.AddInt64(&sum, 1)
+		return nil
+	})
+
+	equals(t, int64(5), sum)
+	if elapsed := time.Since(start); elapsed > time.Millisecond*500 {
+		t.Fatalf("expected a burst of 5 to execute immediately, took %s", elapsed)
+	}
+}
+
+func TestBucketRefillsWhileIdle(t *testing.T) {
+	r := NewBucket(1000, time.Second, 5)
+
+	// Drain the bucket.
+	r.Do(context.Background(), 5, func() error { return nil })
+	equals(t, int64(0), atomic.LoadInt64(&r.tokens))
+
+	// Idle for long enough to refill to the burst cap.
+	time.Sleep(time.Millisecond * 50)
+	r.refill()
+
+	equals(t, int64(5), atomic.LoadInt64(&r.tokens))
+}
+
 func TestCancelDo(t *testing.T) {
 	r := New(10, time.Second)
 	ctx, cancel := context.WithCancel(context.Background())